@@ -0,0 +1,111 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheShardCount is the number of independent map+lock partitions a
+// NormalizerCache splits its keys across. It's fixed rather than
+// configurable since there's no operational reason to tune it per
+// deployment.
+const cacheShardCount = 32
+
+// cacheShard is one partition of a NormalizerCache: its own map and its
+// own lock, so goroutines hashing to different shards never contend.
+type cacheShard struct {
+	mu      sync.RWMutex
+	entries map[string]CacheEntry
+}
+
+// NormalizerCache is the sharded, TTL-bounded replacement for a single
+// global map: processPacket is safe to call concurrently against it,
+// since each cacheKey only ever contends with the other keys that hash
+// to the same shard. A background janitor evicts entries that haven't
+// been refreshed within ttl, so a cache fed by thousands of hosts and
+// plugins doesn't grow without bound once a host stops reporting.
+type NormalizerCache struct {
+	shards    [cacheShardCount]*cacheShard
+	ttl       time.Duration
+	evictions uint64
+}
+
+// NewNormalizerCache builds a cache and starts its janitor goroutine.
+func NewNormalizerCache(ttl time.Duration) *NormalizerCache {
+	c := &NormalizerCache{ttl: ttl}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{entries: make(map[string]CacheEntry)}
+	}
+	go c.janitor()
+	return c
+}
+
+func (c *NormalizerCache) shardFor(key string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%cacheShardCount]
+}
+
+// Get returns the cached entry for key, if present.
+func (c *NormalizerCache) Get(key string) (CacheEntry, bool) {
+	shard := c.shardFor(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	entry, ok := shard.entries[key]
+	return entry, ok
+}
+
+// Set records entry for key and refreshes its LastSeen timestamp so the
+// janitor won't evict it before another ttl passes.
+func (c *NormalizerCache) Set(key string, entry CacheEntry) {
+	entry.LastSeen = time.Now()
+	shard := c.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.entries[key] = entry
+}
+
+// Size returns the number of entries currently cached, across all shards.
+func (c *NormalizerCache) Size() int {
+	total := 0
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		total += len(shard.entries)
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// Evictions returns the number of entries the janitor has evicted since
+// startup.
+func (c *NormalizerCache) Evictions() uint64 {
+	return atomic.LoadUint64(&c.evictions)
+}
+
+func (c *NormalizerCache) janitor() {
+	interval := c.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.evictExpired()
+	}
+}
+
+func (c *NormalizerCache) evictExpired() {
+	cutoff := time.Now().Add(-c.ttl)
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		for key, entry := range shard.entries {
+			if entry.LastSeen.Before(cutoff) {
+				delete(shard.entries, key)
+				atomic.AddUint64(&c.evictions, 1)
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNormalizerCacheGetSet(t *testing.T) {
+	c := NewNormalizerCache(time.Minute)
+
+	if _, ok := c.Get("missing"); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+
+	c.Set("host.cpu.cpu-0", CacheEntry{Timestamp: 1000, Value: 42})
+
+	entry, ok := c.Get("host.cpu.cpu-0")
+	if !ok {
+		t.Fatal("expected hit after Set")
+	}
+	if entry.Value != 42 || entry.Timestamp != 1000 {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestNormalizerCacheSpreadsAcrossShards(t *testing.T) {
+	c := NewNormalizerCache(time.Minute)
+
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprintf("host%d.cpu.cpu-0", i), CacheEntry{Value: float64(i)})
+	}
+
+	if got := c.Size(); got != 100 {
+		t.Fatalf("expected 100 entries, got %d", got)
+	}
+}
+
+func TestNormalizerCacheEvictsExpired(t *testing.T) {
+	c := NewNormalizerCache(time.Millisecond)
+	c.Set("host.cpu.cpu-0", CacheEntry{Value: 1})
+	time.Sleep(5 * time.Millisecond)
+
+	c.evictExpired()
+
+	if _, ok := c.Get("host.cpu.cpu-0"); ok {
+		t.Fatal("expected entry to have been evicted")
+	}
+	if got := c.Evictions(); got != 1 {
+		t.Fatalf("expected 1 eviction, got %d", got)
+	}
+	if got := c.Size(); got != 0 {
+		t.Fatalf("expected empty cache after eviction, got size %d", got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/avinson/influxdb-collectd-proxy/sinks"
+)
+
+// sinkConfig is one entry of the "sinks" array in the -config file: a
+// sink type name plus that sink's own JSON config blob.
+type sinkConfig struct {
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+}
+
+// proxyConfig is the top-level shape of the -config file.
+//
+// This supersedes the -influxdb/-username/-password/-database flags the
+// proxy used to take: once a second sink (NATS) needed its own connection
+// parameters, per-backend flags stopped scaling, so all backend
+// configuration - including InfluxDB's - moved here. sinks.InfluxSink.Init
+// takes those settings (Host, Username, Password, Database) plus the v2
+// ones (Version, Scheme, Org, Bucket, Token) as JSON instead of flags; see
+// sinks/influx.go.
+type proxyConfig struct {
+	Sinks   []sinkConfig       `json:"sinks"`
+	Filters []filterRuleConfig `json:"filters"`
+}
+
+// readProxyConfig reads and parses the -config file.
+func readProxyConfig(path string) (*proxyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var config proxyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	return &config, nil
+}
+
+// loadSinks reads the -config file and builds one sinks.Sink per entry,
+// already Init'd against its own config blob.
+func loadSinks(path string) ([]sinks.Sink, error) {
+	config, err := readProxyConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]sinks.Sink, 0, len(config.Sinks))
+	for _, sc := range config.Sinks {
+		sink, err := newSink(sc.Type)
+		if err != nil {
+			return nil, err
+		}
+		if err := sink.Init(sc.Config); err != nil {
+			return nil, fmt.Errorf("failed to init %s sink: %v", sc.Type, err)
+		}
+		result = append(result, sink)
+	}
+	return result, nil
+}
+
+// newSink returns a zero-valued Sink for the given config "type" name.
+func newSink(sinkType string) (sinks.Sink, error) {
+	switch sinkType {
+	case "influx":
+		return &sinks.InfluxSink{}, nil
+	case "nats":
+		return &sinks.NatsSink{}, nil
+	case "mqtt":
+		return &sinks.MqttSink{}, nil
+	case "stdout":
+		return &sinks.StdoutSink{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink type: %q", sinkType)
+	}
+}
+
+// loadFilterChain reads the -config file and compiles its "filters"
+// array into a FilterChain.
+func loadFilterChain(path string) (*FilterChain, error) {
+	config, err := readProxyConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFilterChain(config.Filters)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sync"
+
+	"github.com/avinson/influxdb-collectd-proxy/sinks"
+)
+
+// filterRuleConfig is one entry of the "filters" array in the config
+// file. Match fields are glob patterns by default, or regexes when
+// Regex is true; an empty match field always matches.
+type filterRuleConfig struct {
+	Action string `json:"action"` // "include", "exclude", or "rewrite"
+
+	Plugin         string `json:"plugin"`
+	PluginInstance string `json:"plugin_instance"`
+	Type           string `json:"type"`
+	TypeInstance   string `json:"type_instance"`
+	Hostname       string `json:"hostname"`
+	Regex          bool   `json:"regex"`
+
+	// rewrite-only fields
+	Measurement string            `json:"measurement"`
+	SetTags     map[string]string `json:"set_tags"`
+	DropTags    []string          `json:"drop_tags"`
+	Scale       float64           `json:"scale"`
+}
+
+type filterMatcher func(value string) bool
+
+type compiledRule struct {
+	action string
+
+	plugin, pluginInstance, typ, typeInstance, hostname filterMatcher
+
+	measurement string
+	setTags     map[string]string
+	dropTags    []string
+	scale       float64
+}
+
+// FilterChain is a compiled, ordered sequence of include/exclude/rewrite
+// rules that every point is run through between processPacket and the
+// sinks. Rules are evaluated in file order: an "exclude" match drops the
+// point immediately, an "include" match keeps it immediately (so it's
+// not later dropped by a broader exclude rule), and "rewrite" rules
+// mutate the point and keep evaluating. A point that matches nothing
+// is kept as-is.
+type FilterChain struct {
+	mu    sync.RWMutex
+	rules []compiledRule
+}
+
+// NewFilterChain compiles rule configs loaded from the config file.
+func NewFilterChain(configs []filterRuleConfig) (*FilterChain, error) {
+	rules, err := compileFilterRules(configs)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterChain{rules: rules}, nil
+}
+
+// Reload atomically swaps in a newly compiled rule set, e.g. on SIGHUP.
+func (f *FilterChain) Reload(configs []filterRuleConfig) error {
+	rules, err := compileFilterRules(configs)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.rules = rules
+	f.mu.Unlock()
+	return nil
+}
+
+// Apply runs p through the chain, returning the possibly-rewritten point
+// and whether it should still be forwarded to the sinks.
+func (f *FilterChain) Apply(p sinks.Point) (sinks.Point, bool) {
+	f.mu.RLock()
+	rules := f.rules
+	f.mu.RUnlock()
+
+	for _, rule := range rules {
+		if !rule.matches(p) {
+			continue
+		}
+		switch rule.action {
+		case "exclude":
+			return p, false
+		case "include":
+			return p, true
+		case "rewrite":
+			p = applyRewrite(p, rule)
+		}
+	}
+	return p, true
+}
+
+func compileFilterRules(configs []filterRuleConfig) ([]compiledRule, error) {
+	rules := make([]compiledRule, 0, len(configs))
+	for _, c := range configs {
+		switch c.Action {
+		case "include", "exclude", "rewrite":
+		default:
+			return nil, fmt.Errorf("unknown filter action: %q", c.Action)
+		}
+
+		rule := compiledRule{
+			action:      c.Action,
+			measurement: c.Measurement,
+			setTags:     c.SetTags,
+			dropTags:    c.DropTags,
+			scale:       c.Scale,
+		}
+
+		var err error
+		if rule.plugin, err = newFilterMatcher(c.Plugin, c.Regex); err != nil {
+			return nil, err
+		}
+		if rule.pluginInstance, err = newFilterMatcher(c.PluginInstance, c.Regex); err != nil {
+			return nil, err
+		}
+		if rule.typ, err = newFilterMatcher(c.Type, c.Regex); err != nil {
+			return nil, err
+		}
+		if rule.typeInstance, err = newFilterMatcher(c.TypeInstance, c.Regex); err != nil {
+			return nil, err
+		}
+		if rule.hostname, err = newFilterMatcher(c.Hostname, c.Regex); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// newFilterMatcher builds a filterMatcher for one match pattern. An
+// empty pattern always matches.
+func newFilterMatcher(pattern string, useRegex bool) (filterMatcher, error) {
+	if pattern == "" {
+		return func(string) bool { return true }, nil
+	}
+	if useRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter regex %q: %v", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	return func(value string) bool {
+		matched, _ := path.Match(pattern, value)
+		return matched
+	}, nil
+}
+
+func (r compiledRule) matches(p sinks.Point) bool {
+	return r.plugin(p.Tags["plugin"]) &&
+		r.pluginInstance(p.Tags["plugin_instance"]) &&
+		r.typ(p.Tags["type"]) &&
+		r.typeInstance(p.Tags["type_instance"]) &&
+		r.hostname(p.Tags["host"])
+}
+
+// applyRewrite renames the measurement, adds/drops tags, and/or scales
+// field values on a copy of p.
+func applyRewrite(p sinks.Point, rule compiledRule) sinks.Point {
+	if rule.measurement != "" {
+		p.Measurement = rule.measurement
+	}
+
+	if len(rule.dropTags) > 0 || len(rule.setTags) > 0 {
+		tags := make(map[string]string, len(p.Tags))
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		for _, k := range rule.dropTags {
+			delete(tags, k)
+		}
+		for k, v := range rule.setTags {
+			tags[k] = v
+		}
+		p.Tags = tags
+	}
+
+	if rule.scale != 0 {
+		fields := make(map[string]interface{}, len(p.Fields))
+		for k, v := range p.Fields {
+			if n, ok := v.(float64); ok {
+				fields[k] = n * rule.scale
+			} else {
+				fields[k] = v
+			}
+		}
+		p.Fields = fields
+	}
+
+	return p
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/avinson/influxdb-collectd-proxy/sinks"
+)
+
+func TestFilterChainExcludeGlob(t *testing.T) {
+	chain, err := NewFilterChain([]filterRuleConfig{
+		{Action: "exclude", PluginInstance: "lo"},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	excluded := sinks.Point{Tags: map[string]string{"plugin": "interface", "plugin_instance": "lo"}}
+	if _, ok := chain.Apply(excluded); ok {
+		t.Fatal("expected interface-lo to be excluded")
+	}
+
+	kept := sinks.Point{Tags: map[string]string{"plugin": "interface", "plugin_instance": "eth0"}}
+	if _, ok := chain.Apply(kept); !ok {
+		t.Fatal("expected interface-eth0 to be kept")
+	}
+}
+
+func TestFilterChainIncludeShortCircuitsLaterExclude(t *testing.T) {
+	chain, err := NewFilterChain([]filterRuleConfig{
+		{Action: "include", Plugin: "cpu"},
+		{Action: "exclude", Plugin: "*"},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	cpu := sinks.Point{Tags: map[string]string{"plugin": "cpu"}}
+	if _, ok := chain.Apply(cpu); !ok {
+		t.Fatal("expected cpu to survive the later catch-all exclude")
+	}
+
+	mem := sinks.Point{Tags: map[string]string{"plugin": "memory"}}
+	if _, ok := chain.Apply(mem); ok {
+		t.Fatal("expected memory to be dropped by the catch-all exclude")
+	}
+}
+
+func TestFilterChainRewrite(t *testing.T) {
+	chain, err := NewFilterChain([]filterRuleConfig{
+		{
+			Action:      "rewrite",
+			Plugin:      "cpu",
+			Measurement: "cpu_usage",
+			SetTags:     map[string]string{"core": "0"},
+			DropTags:    []string{"plugin_instance"},
+			Scale:       100,
+		},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	p := sinks.Point{
+		Measurement: "collectd",
+		Tags:        map[string]string{"plugin": "cpu", "plugin_instance": "0"},
+		Fields:      map[string]interface{}{"value": 0.42},
+	}
+	out, ok := chain.Apply(p)
+	if !ok {
+		t.Fatal("expected point to survive the rewrite")
+	}
+	if out.Measurement != "cpu_usage" {
+		t.Fatalf("got measurement %q, want %q", out.Measurement, "cpu_usage")
+	}
+	if out.Tags["core"] != "0" {
+		t.Fatal("expected core tag to be set")
+	}
+	if _, exists := out.Tags["plugin_instance"]; exists {
+		t.Fatal("expected plugin_instance tag to be dropped")
+	}
+	if out.Fields["value"].(float64) != 42 {
+		t.Fatalf("got value %v, want 42", out.Fields["value"])
+	}
+	// the rewrite mutated a copy; the original point must be untouched
+	if _, exists := p.Tags["plugin_instance"]; !exists {
+		t.Fatal("rewrite must not mutate the original point's tags")
+	}
+}
+
+func TestFilterChainRegexMatch(t *testing.T) {
+	chain, err := NewFilterChain([]filterRuleConfig{
+		{Action: "exclude", Type: "^cpu$", Regex: true},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	p := sinks.Point{Tags: map[string]string{"type": "cpu"}}
+	if _, ok := chain.Apply(p); ok {
+		t.Fatal("expected regex-matched type to be excluded")
+	}
+
+	other := sinks.Point{Tags: map[string]string{"type": "cpufreq"}}
+	if _, ok := chain.Apply(other); !ok {
+		t.Fatal("expected anchored regex not to match cpufreq")
+	}
+}
+
+func TestNewFilterChainRejectsUnknownAction(t *testing.T) {
+	if _, err := NewFilterChain([]filterRuleConfig{{Action: "bogus"}}); err == nil {
+		t.Fatal("expected an error for an unknown filter action")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avinson/influxdb-collectd-proxy/sinks"
+)
+
+// promMetric is the last known value of one collectd series, enough to
+// render a single Prometheus sample line. Every series is exported as a
+// gauge: with -normalize (the default) even a COUNTER/DERIVE source
+// arrives here already normalized into a rate by processPacket, which is
+// non-monotonic and
+// would be mangled by PromQL's rate() if advertised as a counter.
+type promMetric struct {
+	name     string
+	labels   map[string]string
+	value    float64
+	lastSeen time.Time
+}
+
+// PromExporter tracks the most recent value of every collectd metric
+// processPacket has seen and renders them as Prometheus text exposition
+// format on demand, so the proxy can be scraped directly in addition to
+// (or instead of) pushing to a sink.
+type PromExporter struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	metrics map[string]*promMetric
+	cache   *NormalizerCache
+}
+
+// NewPromExporter builds an exporter that forgets a series once it's
+// gone ttl without an update. cache is optional and, if set, has its
+// size and eviction count exposed alongside the collectd metrics.
+func NewPromExporter(ttl time.Duration, cache *NormalizerCache) *PromExporter {
+	return &PromExporter{
+		ttl:     ttl,
+		metrics: make(map[string]*promMetric),
+		cache:   cache,
+	}
+}
+
+// Observe records the latest value for seriesKey, which callers should
+// derive from the point actually forwarded to the sinks (post-filter),
+// so a series excluded or rewritten by the FilterChain is reflected
+// here too instead of bypassing it.
+func (e *PromExporter) Observe(seriesKey, name string, labels map[string]string, value float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metrics[seriesKey] = &promMetric{
+		name:     name,
+		labels:   labels,
+		value:    value,
+		lastSeen: time.Now(),
+	}
+}
+
+// ServeHTTP renders the current metric set as Prometheus text exposition
+// format, evicting anything older than ttl so hosts that stopped
+// reporting don't linger forever.
+func (e *PromExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(e.metrics))
+	for key, m := range e.metrics {
+		if now.Sub(m.lastSeen) > e.ttl {
+			delete(e.metrics, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		mi, mj := e.metrics[keys[i]], e.metrics[keys[j]]
+		if mi.name != mj.name {
+			return mi.name < mj.name
+		}
+		return keys[i] < keys[j]
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	lastName := ""
+	for _, key := range keys {
+		m := e.metrics[key]
+		if m.name != lastName {
+			fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+			lastName = m.name
+		}
+		fmt.Fprintf(w, "%s{%s} %v\n", m.name, formatPromLabels(m.labels), m.value)
+	}
+
+	if e.cache != nil {
+		fmt.Fprintf(w, "# TYPE collectd_proxy_cache_size gauge\n")
+		fmt.Fprintf(w, "collectd_proxy_cache_size %d\n", e.cache.Size())
+		fmt.Fprintf(w, "# TYPE collectd_proxy_cache_evictions_total counter\n")
+		fmt.Fprintf(w, "collectd_proxy_cache_evictions_total %d\n", e.cache.Evictions())
+	}
+}
+
+var promNameReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// promName builds a valid Prometheus metric name out of a collectd
+// plugin and type, e.g. ("cpu", "cpu") -> "collectd_cpu_cpu".
+func promName(plugin, typeName string) string {
+	return "collectd_" + promNameReplacer.Replace(plugin) + "_" + promNameReplacer.Replace(typeName)
+}
+
+// promNameForPoint derives the metric name from a point's plugin/type
+// tags rather than the raw collectd packet, since a FilterChain rewrite
+// rule can rename the measurement or drop tags before the point reaches
+// the exporter. It falls back to the (possibly rewritten) measurement
+// when the plugin tag is missing, and leaves the type out of the name
+// when the type tag is missing.
+func promNameForPoint(p sinks.Point) string {
+	plugin := p.Tags["plugin"]
+	if plugin == "" {
+		plugin = p.Measurement
+	}
+	typeName := p.Tags["type"]
+	if typeName == "" {
+		return "collectd_" + promNameReplacer.Replace(plugin)
+	}
+	return promName(plugin, typeName)
+}
+
+// promSeriesKey identifies a point for exporter dedup purposes: the
+// (possibly rewritten) measurement plus its full, sorted tag set. Using
+// the post-filter point rather than the original collectd cacheKey
+// means a rewrite rule that changes tags is reflected in what's exposed
+// rather than silently colliding with the pre-rewrite series.
+func promSeriesKey(p sinks.Point) string {
+	return p.Measurement + "{" + formatPromLabels(p.Tags) + "}"
+}
+
+// formatPromLabels renders labels in a stable order so repeated scrapes
+// diff cleanly.
+func formatPromLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -2,14 +2,17 @@ package main
 
 import (
 	"flag"
+	"hash/fnv"
 	"log"
 	"math"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	influxdb "github.com/influxdb/influxdb-go"
+	"github.com/avinson/influxdb-collectd-proxy/sinks"
 	collectd "github.com/paulhammond/gocollectd"
 )
 
@@ -22,32 +25,46 @@ var (
 	typesdbPath *string
 	logPath     *string
 	verbose     *bool
-
-	// influxdb options
-	host      *string
-	username  *string
-	password  *string
-	database  *string
-	normalize *bool
+	configPath  *string
+	normalize   *bool
+	promListen  *string
+	promTTL     *time.Duration
+	cacheTTL    *time.Duration
+	workerCount *int
 
 	types       Types
-	client      *influxdb.Client
-	beforeCache map[string]CacheEntry
+	sinkList    []sinks.Sink
+	beforeCache *NormalizerCache
+	promMetrics *PromExporter
+	filterChain *FilterChain
 )
 
 // point cache to perform data normalization for COUNTER and DERIVE types
 type CacheEntry struct {
 	Timestamp int64
 	Value     float64
+	LastSeen  time.Time
 }
 
 // signal handler
 func handleSignals(c chan os.Signal) {
-	// block until a signal is received
-	sig := <-c
+	for sig := range c {
+		if sig == syscall.SIGHUP {
+			log.Printf("got SIGHUP, reloading filters from %s\n", *configPath)
+			config, err := readProxyConfig(*configPath)
+			if err != nil {
+				log.Printf("failed to reload config: %v\n", err)
+				continue
+			}
+			if err := filterChain.Reload(config.Filters); err != nil {
+				log.Printf("failed to reload filters: %v\n", err)
+			}
+			continue
+		}
 
-	log.Printf("exit with a signal: %v\n", sig)
-	os.Exit(1)
+		log.Printf("exit with a signal: %v\n", sig)
+		os.Exit(1)
+	}
 }
 
 func init() {
@@ -56,17 +73,20 @@ func init() {
 	typesdbPath = flag.String("typesdb", "types.db", "path to Collectd's types.db")
 	logPath = flag.String("logfile", "proxy.log", "path to log file")
 	verbose = flag.Bool("verbose", false, "true if you need to trace the requests")
-
-	// influxdb options
-	host = flag.String("influxdb", "localhost:8086", "host:port for influxdb")
-	username = flag.String("username", "root", "username for influxdb")
-	password = flag.String("password", "root", "password for influxdb")
-	database = flag.String("database", "", "database for influxdb")
+	configPath = flag.String("config", "sinks.json", "path to the sinks config file")
 	normalize = flag.Bool("normalize", true, "true if you need to normalize data for COUNTER and DERIVE types (over time)")
+	promListen = flag.String("promlisten", "", "address to serve a Prometheus /metrics endpoint on, e.g. :9103 (disabled if empty)")
+	promTTL = flag.Duration("prom-ttl", 10*time.Minute, "how long a collectd series is exposed on /metrics after its last update")
+	cacheTTL = flag.Duration("cache-ttl", 10*time.Minute, "how long a normalization cache entry survives without an update before it's evicted")
+	workerCount = flag.Int("workers", 4, "number of goroutines processing packets concurrently")
 
 	flag.Parse()
 
-	beforeCache = make(map[string]CacheEntry)
+	if *workerCount < 1 {
+		log.Fatalf("-workers must be >= 1, got %d\n", *workerCount)
+	}
+
+	beforeCache = NewNormalizerCache(*cacheTTL)
 
 	// read types.db
 	var err error
@@ -84,20 +104,40 @@ func main() {
 	log.SetOutput(logFile)
 	defer logFile.Close()
 
-	// make influxdb client
-	client, err = influxdb.NewClient(&influxdb.ClientConfig{
-		Host:     *host,
-		Username: *username,
-		Password: *password,
-		Database: *database,
-	})
+	// load and initialize the configured sinks
+	sinkList, err = loadSinks(*configPath)
+	if err != nil {
+		log.Fatalf("failed to load sinks: %v\n", err)
+	}
+	defer func() {
+		for _, sink := range sinkList {
+			sink.Close()
+		}
+	}()
+
+	// load the filter/rewrite chain run between processPacket and the sinks
+	filterChain, err = loadFilterChain(*configPath)
 	if err != nil {
-		log.Fatalf("failed to make a influxdb client: %v\n", err)
+		log.Fatalf("failed to load filters: %v\n", err)
+	}
+
+	// optionally serve a Prometheus /metrics endpoint alongside the sinks
+	if *promListen != "" {
+		promMetrics = NewPromExporter(*promTTL, beforeCache)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promMetrics)
+		go func() {
+			if err := http.ListenAndServe(*promListen, mux); err != nil {
+				log.Fatalf("failed to serve prometheus metrics: %v\n", err)
+			}
+		}()
+		log.Printf("prometheus metrics served on %s\n", *promListen)
 	}
 
-	// register a signal handler
+	// register a signal handler; SIGHUP reloads the filter chain, other
+	// signals exit
 	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, os.Interrupt, os.Kill)
+	signal.Notify(sc, os.Interrupt, os.Kill, syscall.SIGHUP)
 	go handleSignals(sc)
 
 	// make channel for collectd
@@ -106,38 +146,107 @@ func main() {
 	// then start to listen
 	go collectd.Listen("0.0.0.0:"+*proxyPort, c)
 	log.Printf("proxy started on %s\n", *proxyPort)
+
+	// processPacket's rate normalization reads-then-writes beforeCache
+	// per series, so two packets for the same series must never run
+	// concurrently or a worker can normalize against a stale baseline.
+	// Each series is hashed to one fixed worker, which preserves
+	// per-series ordering while still processing distinct series in
+	// parallel across workers.
+	processed := make(chan []sinks.Point, packetChannelSize)
+	workerChans := make([]chan collectd.Packet, *workerCount)
+	for i := range workerChans {
+		workerChans[i] = make(chan collectd.Packet, packetChannelSize)
+		go func(ch chan collectd.Packet) {
+			for packet := range ch {
+				points := filterPoints(processPacket(packet))
+				observeMetrics(points)
+				processed <- points
+			}
+		}(workerChans[i])
+	}
+	go func() {
+		for packet := range c {
+			workerChans[seriesWorker(packet, *workerCount)] <- packet
+		}
+	}()
+
 	timer := time.Now()
-	seriesGroup := make([]*influxdb.Series, 0)
-	for packet := range c {
-		seriesGroup = append(seriesGroup, processPacket(packet)...)
+	pointGroup := make([]sinks.Point, 0)
+	for points := range processed {
+		pointGroup = append(pointGroup, points...)
 
-		if time.Since(timer) < influxWriteInterval && len(seriesGroup) < influxWriteLimit {
+		if time.Since(timer) < influxWriteInterval && len(pointGroup) < influxWriteLimit {
 			continue
 		} else {
-			if len(seriesGroup) > 0 {
-				go backendWriter(seriesGroup)
-				seriesGroup = make([]*influxdb.Series, 0)
+			if len(pointGroup) > 0 {
+				go backendWriter(pointGroup)
+				pointGroup = make([]sinks.Point, 0)
 			}
 			timer = time.Now()
 		}
 	}
 }
 
-func backendWriter(seriesGroup []*influxdb.Series) {
-	if err := client.WriteSeries(seriesGroup); err != nil {
-		log.Printf("failed to write series group to influxdb: %s\n", err)
+// filterPoints runs each point through the configured FilterChain,
+// dropping the ones it excludes and keeping the (possibly rewritten)
+// rest.
+func filterPoints(points []sinks.Point) []sinks.Point {
+	kept := points[:0]
+	for _, p := range points {
+		if rewritten, ok := filterChain.Apply(p); ok {
+			kept = append(kept, rewritten)
+		}
+	}
+	return kept
+}
+
+// observeMetrics feeds the Prometheus exporter, if enabled, from points
+// that have already passed the FilterChain: an excluded series never
+// shows up on /metrics, and a rewrite rule's added or dropped tags and
+// scaled value are what gets exported. A renamed measurement shows in the
+// metric name only when the point has no plugin tag (see promNameForPoint).
+func observeMetrics(points []sinks.Point) {
+	if promMetrics == nil {
+		return
+	}
+	for _, p := range points {
+		value, _ := p.Fields["value"].(float64)
+		promMetrics.Observe(promSeriesKey(p), promNameForPoint(p), p.Tags, value)
+	}
+}
+
+func backendWriter(pointGroup []sinks.Point) {
+	for _, sink := range sinkList {
+		if err := sink.Write(pointGroup); err != nil {
+			log.Printf("failed to write points to a sink: %s\n", err)
+		}
 	}
 	if *verbose {
-		log.Printf("[TRACE] wrote %d series\n", len(seriesGroup))
+		log.Printf("[TRACE] wrote %d points to %d sinks\n", len(pointGroup), len(sinkList))
 	}
 }
 
-func processPacket(packet collectd.Packet) []*influxdb.Series {
+// seriesWorker picks which of n workers owns packet's series, hashing
+// the same identity fields processPacket folds into cacheKey so every
+// packet for a given series is always handled by the same goroutine in
+// order.
+func seriesWorker(packet collectd.Packet, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(packet.Hostname))
+	h.Write([]byte(packet.Plugin))
+	h.Write([]byte(packet.PluginInstance))
+	h.Write([]byte(packet.Type))
+	h.Write([]byte(packet.TypeInstance))
+	return int(h.Sum32() % uint32(n))
+}
+
+func processPacket(packet collectd.Packet) []sinks.Point {
 	if *verbose {
 		log.Printf("[TRACE] got a packet: %v\n", packet)
 	}
 
-	var seriesGroup []*influxdb.Series
+	var pointGroup []sinks.Point
 	// for all metrics in the packet
 	for i, _ := range packet.ValueNames() {
 		values, _ := packet.ValueNumbers()
@@ -160,16 +269,20 @@ func processPacket(packet collectd.Packet) []*influxdb.Series {
 			pluginName += "-" + packet.PluginInstance
 		}
 
-		// if there's a TypeInstance, use it
+		// if there's a TypeInstance, use it; otherwise fall back to the
+		// data source name, since multi-DS types (load, if_octets,
+		// disk_ops, ...) have no TypeInstance but still need something
+		// to keep their DS values from colliding on the same series.
 		typeName := packet.Type
+		dsName := ""
 		if packet.TypeInstance != "" {
 			typeName += "-" + packet.TypeInstance
 		} else if t != nil {
-			typeName += "-" + t[i]
+			dsName = t[i]
+			typeName += "-" + dsName
 		}
 
 		cacheKey := hostName + "." + pluginName + "." + typeName
-		name := pluginName + "." + typeName
 
 		// influxdb stuffs
 		timestamp := packet.Time().UnixNano() / 1000000
@@ -178,8 +291,8 @@ func processPacket(packet collectd.Packet) []*influxdb.Series {
 		readyToSend := true
 		normalizedValue := value
 
-		if *normalize && dataType == collectd.TypeCounter || dataType == collectd.TypeDerive {
-			if before, ok := beforeCache[cacheKey]; ok && !math.IsNaN(before.Value) {
+		if *normalize && (dataType == collectd.TypeCounter || dataType == collectd.TypeDerive) {
+			if before, ok := beforeCache.Get(cacheKey); ok && !math.IsNaN(before.Value) {
 				// normalize over time
 				if timestamp-before.Timestamp > 0 {
 					normalizedValue = (value - before.Value) / float64((timestamp-before.Timestamp)/1000)
@@ -190,26 +303,42 @@ func processPacket(packet collectd.Packet) []*influxdb.Series {
 				// skip current data if there's no initial entry
 				readyToSend = false
 			}
-			entry := CacheEntry{
+			beforeCache.Set(cacheKey, CacheEntry{
 				Timestamp: timestamp,
 				Value:     value,
-			}
-			beforeCache[cacheKey] = entry
+			})
 		}
 
 		if readyToSend {
-			series := &influxdb.Series{
-				Name:    name,
-				Columns: []string{"time", "value", "host"},
-				Points: [][]interface{}{
-					[]interface{}{timestamp, normalizedValue, hostName},
-				},
+			tags := map[string]string{
+				"host":   hostName,
+				"plugin": packet.Plugin,
+				"type":   packet.Type,
+			}
+			if packet.PluginInstance != "" {
+				tags["plugin_instance"] = packet.PluginInstance
+			}
+			if packet.TypeInstance != "" {
+				tags["type_instance"] = packet.TypeInstance
+			}
+			if dsName != "" {
+				tags["dsname"] = dsName
+			}
+			fields := map[string]interface{}{
+				"value": normalizedValue,
+			}
+
+			point := sinks.Point{
+				Measurement: "collectd",
+				Tags:        tags,
+				Fields:      fields,
+				Time:        time.Unix(0, timestamp*int64(time.Millisecond)),
 			}
 			if *verbose {
-				log.Printf("[TRACE] ready to send series: %v\n", series)
+				log.Printf("[TRACE] ready to send point: %v\n", point)
 			}
-			seriesGroup = append(seriesGroup, series)
+			pointGroup = append(pointGroup, point)
 		}
 	}
-	return seriesGroup
+	return pointGroup
 }
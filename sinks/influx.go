@@ -0,0 +1,128 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	influxdb1 "github.com/influxdb/influxdb-go"
+)
+
+// InfluxSink forwards points to an InfluxDB v1 or v2 server, depending
+// on Version. It's the same writer the proxy used before sinks existed,
+// now wearing the Sink interface.
+type InfluxSink struct {
+	Version  int    `json:"version"`
+	Scheme   string `json:"scheme"`
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Database string `json:"database"`
+	Org      string `json:"org"`
+	Bucket   string `json:"bucket"`
+	Token    string `json:"token"`
+
+	client   influxdb2.Client
+	writeAPI api.WriteAPIBlocking
+
+	v1Client *influxdb1.Client
+	v1Mu     sync.Mutex
+}
+
+func (s *InfluxSink) Init(config json.RawMessage) error {
+	if err := json.Unmarshal(config, s); err != nil {
+		return fmt.Errorf("invalid influx sink config: %v", err)
+	}
+	if s.Version == 0 {
+		s.Version = 2
+	}
+	if s.Scheme == "" {
+		s.Scheme = "http"
+	}
+
+	switch s.Version {
+	case 2:
+		url := fmt.Sprintf("%s://%s", s.Scheme, s.Host)
+		s.client = influxdb2.NewClient(url, s.Token)
+		s.writeAPI = s.client.WriteAPIBlocking(s.Org, s.Bucket)
+		return nil
+	case 1:
+		client, err := influxdb1.NewClient(&influxdb1.ClientConfig{
+			Host:     s.Host,
+			Username: s.Username,
+			Password: s.Password,
+			Database: s.Database,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to make a influxdb client: %v", err)
+		}
+		s.v1Client = client
+		return nil
+	default:
+		return fmt.Errorf("unsupported influx sink version: %d", s.Version)
+	}
+}
+
+func (s *InfluxSink) Write(points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	switch s.Version {
+	case 2:
+		wp := make([]*write.Point, 0, len(points))
+		for _, p := range points {
+			wp = append(wp, write.NewPoint(p.Measurement, p.Tags, p.Fields, p.Time))
+		}
+		return s.writeAPI.WritePoint(context.Background(), wp...)
+	case 1:
+		s.v1Mu.Lock()
+		defer s.v1Mu.Unlock()
+		return s.v1Client.WriteSeries(pointsToSeriesV1(points))
+	default:
+		return fmt.Errorf("unsupported influx sink version: %d", s.Version)
+	}
+}
+
+func (s *InfluxSink) Close() error {
+	if s.client != nil {
+		s.client.Close()
+	}
+	return nil
+}
+
+// pointsToSeriesV1 folds a Point (measurement + tags + fields) back down
+// to the flat, 3-column series shape the v1 client understands: tags
+// other than "host" are merged into the series name since v1 has no tag
+// concept.
+func pointsToSeriesV1(points []Point) []*influxdb1.Series {
+	series := make([]*influxdb1.Series, 0, len(points))
+	for _, p := range points {
+		name := p.Measurement
+		host := p.Tags["host"]
+		keys := make([]string, 0, len(p.Tags))
+		for key := range p.Tags {
+			if key != "host" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			name += "." + p.Tags[key]
+		}
+
+		series = append(series, &influxdb1.Series{
+			Name:    name,
+			Columns: []string{"time", "value", "host"},
+			Points: [][]interface{}{
+				{p.Time.UnixNano() / int64(1000000), p.Fields["value"], host},
+			},
+		})
+	}
+	return series
+}
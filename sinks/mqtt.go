@@ -0,0 +1,85 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MqttSink publishes each point as a JSON-encoded message to a topic
+// derived from Topic (the "topic_prefix" config key) and the point's
+// plugin tag, so downstream
+// subscribers can filter per-plugin (e.g. "collectd/cpu") the same way
+// NatsSink lets them filter per-subject.
+type MqttSink struct {
+	Broker   string `json:"broker"`
+	ClientID string `json:"client_id"`
+	Topic    string `json:"topic_prefix"`
+	QoS      byte   `json:"qos"`
+
+	client mqtt.Client
+}
+
+type mqttMessage struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Time        int64                  `json:"time"`
+}
+
+func (s *MqttSink) Init(config json.RawMessage) error {
+	if err := json.Unmarshal(config, s); err != nil {
+		return fmt.Errorf("invalid mqtt sink config: %v", err)
+	}
+	if s.Broker == "" {
+		s.Broker = "tcp://localhost:1883"
+	}
+	if s.ClientID == "" {
+		s.ClientID = "influxdb-collectd-proxy"
+	}
+	if s.Topic == "" {
+		s.Topic = "collectd"
+	}
+
+	opts := mqtt.NewClientOptions().AddBroker(s.Broker).SetClientID(s.ClientID)
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to connect to mqtt broker: %v", token.Error())
+	}
+	s.client = client
+	return nil
+}
+
+func (s *MqttSink) Write(points []Point) error {
+	for _, p := range points {
+		topic := s.Topic
+		if plugin, ok := p.Tags["plugin"]; ok && plugin != "" {
+			topic += "/" + plugin
+		}
+
+		payload, err := json.Marshal(mqttMessage{
+			Measurement: p.Measurement,
+			Tags:        p.Tags,
+			Fields:      p.Fields,
+			Time:        p.Time.UnixNano() / int64(1000000),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode point: %v", err)
+		}
+
+		token := s.client.Publish(topic, s.QoS, false, payload)
+		if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+			return fmt.Errorf("failed to publish to %s: %v", topic, token.Error())
+		}
+	}
+	return nil
+}
+
+func (s *MqttSink) Close() error {
+	if s.client != nil {
+		s.client.Disconnect(250)
+	}
+	return nil
+}
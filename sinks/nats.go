@@ -0,0 +1,75 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NatsSink publishes each point as a JSON-encoded message to a subject
+// derived from SubjectPrefix and the point's plugin tag, so downstream
+// stream processors can subscribe per-plugin (e.g. "collectd.cpu").
+type NatsSink struct {
+	URL           string `json:"url"`
+	SubjectPrefix string `json:"subject_prefix"`
+
+	conn *nats.Conn
+}
+
+type natsMessage struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Time        int64                  `json:"time"`
+}
+
+func (s *NatsSink) Init(config json.RawMessage) error {
+	if err := json.Unmarshal(config, s); err != nil {
+		return fmt.Errorf("invalid nats sink config: %v", err)
+	}
+	if s.URL == "" {
+		s.URL = nats.DefaultURL
+	}
+	if s.SubjectPrefix == "" {
+		s.SubjectPrefix = "collectd"
+	}
+
+	conn, err := nats.Connect(s.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to nats: %v", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *NatsSink) Write(points []Point) error {
+	for _, p := range points {
+		subject := s.SubjectPrefix
+		if plugin, ok := p.Tags["plugin"]; ok && plugin != "" {
+			subject += "." + plugin
+		}
+
+		payload, err := json.Marshal(natsMessage{
+			Measurement: p.Measurement,
+			Tags:        p.Tags,
+			Fields:      p.Fields,
+			Time:        p.Time.UnixNano() / int64(1000000),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode point: %v", err)
+		}
+
+		if err := s.conn.Publish(subject, payload); err != nil {
+			return fmt.Errorf("failed to publish to %s: %v", subject, err)
+		}
+	}
+	return nil
+}
+
+func (s *NatsSink) Close() error {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+// Package sinks defines the normalized metric shape the proxy forwards
+// and a pluggable Sink interface for where those metrics end up.
+// The proxy (proxy.go) hands every point produced by processPacket to one
+// or more configured sinks instead of calling a single storage backend
+// directly.
+package sinks
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Point is a normalized, already-cache-adjusted collectd metric, ready to
+// be encoded however a given sink needs it.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// Sink is something a batch of Points can be written to: InfluxDB, a
+// message bus, stdout, etc. Init is called once at startup with the
+// sink's slice of raw JSON config; Write is called for every batch of
+// filtered points the proxy accumulates from one or more packets.
+type Sink interface {
+	Init(config json.RawMessage) error
+	Write(points []Point) error
+	Close() error
+}
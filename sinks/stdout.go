@@ -0,0 +1,66 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// StdoutSink writes points as InfluxDB line protocol to Writer (os.Stdout
+// by default), which is handy for previewing what the proxy is about to
+// ship without standing up a real backend.
+type StdoutSink struct {
+	Writer io.Writer `json:"-"`
+}
+
+func (s *StdoutSink) Init(config json.RawMessage) error {
+	if s.Writer == nil {
+		s.Writer = os.Stdout
+	}
+	return nil
+}
+
+func (s *StdoutSink) Write(points []Point) error {
+	for _, p := range points {
+		if _, err := fmt.Fprintln(s.Writer, lineProtocol(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
+
+// lineProtocol renders a Point as a single InfluxDB line-protocol line,
+// with tags sorted for stable, diffable output.
+func lineProtocol(p Point) string {
+	line := p.Measurement
+
+	keys := make([]string, 0, len(p.Tags))
+	for key := range p.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line += fmt.Sprintf(",%s=%s", key, p.Tags[key])
+	}
+
+	fieldKeys := make([]string, 0, len(p.Fields))
+	for key := range p.Fields {
+		fieldKeys = append(fieldKeys, key)
+	}
+	sort.Strings(fieldKeys)
+	line += " "
+	for i, key := range fieldKeys {
+		if i > 0 {
+			line += ","
+		}
+		line += fmt.Sprintf("%s=%v", key, p.Fields[key])
+	}
+
+	return fmt.Sprintf("%s %d", line, p.Time.UnixNano())
+}
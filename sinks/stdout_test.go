@@ -0,0 +1,39 @@
+package sinks
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineProtocol(t *testing.T) {
+	p := Point{
+		Measurement: "collectd",
+		Tags:        map[string]string{"plugin": "cpu", "host": "a"},
+		Fields:      map[string]interface{}{"value": 1.5},
+		Time:        time.Unix(0, 1000),
+	}
+
+	got := lineProtocol(p)
+	want := "collectd,host=a,plugin=cpu value=1.5 1000"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLineProtocolSortsTagsAndFields(t *testing.T) {
+	p := Point{
+		Measurement: "m",
+		Tags:        map[string]string{"z": "1", "a": "2"},
+		Fields:      map[string]interface{}{"z": 1, "a": 2},
+		Time:        time.Unix(0, 0),
+	}
+
+	got := lineProtocol(p)
+	if !strings.HasPrefix(got, "m,a=2,z=1 ") {
+		t.Fatalf("expected sorted tags, got %q", got)
+	}
+	if !strings.Contains(got, " a=2,z=1 ") {
+		t.Fatalf("expected sorted fields, got %q", got)
+	}
+}